@@ -0,0 +1,87 @@
+package route
+
+import (
+	"regexp"
+	"strings"
+)
+
+// splitHostScheme strips a leading scheme and host matcher from route, if present, e.g.
+// "https://{}.example.com/users/{}" splits into scheme "https", host "{}.example.com" and
+// path "/users/{}". A route with no "http://" or "https://" prefix is returned unchanged, with
+// an empty scheme and host.
+func splitHostScheme(route string) (scheme, host, path string) {
+	for _, s := range [...]string{"https", "http"} {
+		prefix := s + "://"
+		if !strings.HasPrefix(route, prefix) {
+			continue
+		}
+
+		rest := route[len(prefix):]
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			return s, rest[:i], rest[i:]
+		}
+		return s, rest, "/"
+	}
+	return "", "", route
+}
+
+// parseHostSegments decomposes a host matcher into a sequence of literal/{}/{name} segments
+// separated by ".". Unlike path segments, host segments don't support catch-alls, optional
+// placeholders or custom regexes.
+func parseHostSegments(host string) (segs []pathSeg, ok bool) {
+	if host == "" {
+		return nil, true
+	}
+
+	for _, label := range strings.Split(host, ".") {
+		if !strings.HasPrefix(label, "{") || !strings.HasSuffix(label, "}") {
+			if strings.ContainsAny(label, "{}") {
+				return nil, false
+			}
+			segs = append(segs, pathSeg{kind: segLiteral, lit: label})
+			continue
+		}
+
+		name, pattern, catchAll, optional, specOk := parseSpecifier(label[1 : len(label)-1])
+		if !specOk || pattern != "" || catchAll || optional {
+			return nil, false
+		}
+		segs = append(segs, pathSeg{kind: segParam, name: name})
+	}
+	return segs, true
+}
+
+// buildHostRegex compiles segs (as produced by parseHostSegments) into a regex matching the host
+// part of a request, ignoring any port.
+func buildHostRegex(segs []pathSeg) *regexp.Regexp {
+	b := strings.Builder{}
+	b.WriteByte('^')
+	for i, s := range segs {
+		if i > 0 {
+			b.WriteString(`\.`)
+		}
+		if s.kind == segParam {
+			b.WriteString(`([^.]+)`)
+		} else {
+			b.WriteString(regexp.QuoteMeta(s.lit))
+		}
+	}
+	b.WriteByte('$')
+	return regexp.MustCompile(b.String())
+}
+
+// matchScheme reports whether r used scheme ("http" or "https"); an empty scheme always matches.
+func matchScheme(scheme string, tls bool) bool {
+	if scheme == "" {
+		return true
+	}
+	return (scheme == "https") == tls
+}
+
+// hostOnly strips a trailing ":port" from host, if present.
+func hostOnly(host string) string {
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		return host[:i]
+	}
+	return host
+}
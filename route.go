@@ -2,12 +2,14 @@ package route
 
 import (
 	"context"
+	"encoding"
 	"errors"
 	"net/http"
 	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // In the event of an invalid route string, Router.Handle may panic with one of the following errors.
@@ -17,26 +19,53 @@ var (
 	ErrTooFew           = errors.New("Invalid route: Less segments than struct fields")
 	ErrTooMany          = errors.New("Invalid route: More segments than struct fields")
 	ErrType             = errors.New("Invalid route: Type cannot be parsed")
+	ErrFieldName        = errors.New("Invalid route: Named placeholder does not match any struct field")
 )
 
 // PathRoute is a simple route struct that stores only a path. See Router.ServeHTTP for more information.
 type PathRoute struct{ Path string }
 
+// Middleware wraps a Handler to produce another Handler, typically adding some behaviour before and/or
+// after calling through to the wrapped Handler, or short-circuiting the request entirely.
+type Middleware func(http.Handler) http.Handler
+
 // Router dispatches HTTP requests to a set of routes.
 type Router struct {
-	routes []routeInfo
+	trie        *trieNode    // routes whose template is plain literal/{}/{/}/{/?} segments
+	routes      *[]routeInfo // routes whose template needs the general regex matcher
+	seq         *int         // shared registration counter, used to break ties between trie and routes
+	middlewares []Middleware
+	parsers     map[reflect.Type]parser // router-local overrides, checked before the package defaults
+
+	byType *map[reflect.Type][]urlTemplate // reversible routes, keyed by routeStruct type, for URL
+	byName *map[string]urlTemplate         // reversible routes, keyed by name, for URLNamed
 }
 
 type routeInfo struct {
-	h  http.Handler
-	re *regexp.Regexp
-	ty reflect.Type
-	ps []parser
+	method           string // "" means the route matches any method
+	catchAllOptional bool   // only meaningful for routes stored in a trieNode's catchAll slice
+	mw               []Middleware
+	h                http.Handler
+	re               *regexp.Regexp // only set for routes in Router.routes, nil for trie routes
+	ty               reflect.Type
+	ps               []parser
+	fieldIdx         []int // fieldIdx[i] is the struct field captured value i binds to
+	seq              int   // registration order, used to resolve ambiguous matches
+
+	scheme string         // "" (any), "http" or "https"; "" unless the route had a host matcher
+	hostRe *regexp.Regexp // nil unless the route began with a "scheme://host" matcher
 }
 
 // NewRouter creates a new Router with no parent.
 func NewRouter() *Router {
-	return &Router{}
+	return &Router{
+		trie:    &trieNode{},
+		routes:  &[]routeInfo{},
+		seq:     new(int),
+		parsers: map[reflect.Type]parser{},
+		byType:  &map[reflect.Type][]urlTemplate{},
+		byName:  &map[string]urlTemplate{},
+	}
 }
 
 // ServeHTTP handles a request, dispatching to the correct route.
@@ -50,37 +79,104 @@ func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// Ensure the path ends with a slash
 	path += "/"
 
-	// Iterate backwards so more recently added routes take preference
-	for i := len(router.routes) - 1; i >= 0; i-- {
-		if router.routes[i].serve(w, r, path) {
+	candidates := router.findCandidates(path)
+	sortBySeqDesc(candidates)
+
+	// pathMatched and allowed track routes whose path (and host/scheme) matched but whose method
+	// didn't, so we can tell a 404 apart from a 405 once we've tried every candidate.
+	pathMatched := false
+	var allowed []string
+
+	for _, c := range candidates {
+		if !matchScheme(c.ri.scheme, r.TLS != nil) {
+			continue
+		}
+
+		capture := c.capture
+		if c.ri.hostRe != nil {
+			hostMatch := c.ri.hostRe.FindStringSubmatch(hostOnly(r.Host))
+			if hostMatch == nil {
+				continue
+			}
+			capture = append(append([]string{}, hostMatch[1:]...), capture...)
+		}
+		pathMatched = true
+
+		if c.ri.method != "" && c.ri.method != r.Method {
+			allowed = appendAllowed(allowed, c.ri.method)
+			continue
+		}
+
+		if c.ri.bind(w, r, capture) {
 			return
 		}
 	}
+
+	if pathMatched && len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
 	http.NotFound(w, r)
 }
 
-// Attempt to match and serve the route.
-func (route *routeInfo) serve(w http.ResponseWriter, r *http.Request, path string) (ok bool) {
-	match := route.re.FindStringSubmatch(path)
-	if match == nil {
-		return false
+// findCandidates returns every registered route that matches path, from both the trie and the
+// regex fallback list, without regard to HTTP method.
+func (router *Router) findCandidates(path string) []matchCandidate {
+	var candidates []matchCandidate
+	router.trie.collect(splitSegments(path), nil, &candidates)
+
+	for i := range *router.routes {
+		route := &(*router.routes)[i]
+		match := route.re.FindStringSubmatch(path)
+		if match != nil {
+			candidates = append(candidates, matchCandidate{route, match[1:]})
+		}
+	}
+
+	return candidates
+}
+
+func appendAllowed(allowed []string, method string) []string {
+	for _, m := range allowed {
+		if m == method {
+			return allowed
+		}
 	}
+	return append(allowed, method)
+}
 
-	match = match[1:] // Remove full match
+// Attempt to bind the route's struct fields from an already-matched path's captured values and
+// serve the request.
+func (route *routeInfo) bind(w http.ResponseWriter, r *http.Request, capture []string) (ok bool) {
 	rval := reflect.New(route.ty).Elem()
 	for i, parser := range route.ps {
-		v, err := parser(match[i])
+		v, err := parser(capture[i])
 		if err != nil {
 			return false
 		}
-		rval.Field(i).Set(reflect.ValueOf(v))
+		rval.Field(route.fieldIdx[i]).Set(reflect.ValueOf(v))
 	}
 
-	newCtx := context.WithValue(r.Context(), "route", rval.Interface())
-	route.h.ServeHTTP(w, r.WithContext(newCtx))
+	// The route context value is set inside the innermost handler, so middleware always runs first
+	// and can still short-circuit the request before it's set.
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		newCtx := context.WithValue(r.Context(), "route", rval.Interface())
+		route.h.ServeHTTP(w, r.WithContext(newCtx))
+	})
+	chain(route.mw, final).ServeHTTP(w, r)
 	return true
 }
 
+// chain wraps final in mw, in order, so mw[0] is outermost and runs first.
+func chain(mw []Middleware, final http.Handler) http.Handler {
+	h := final
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
 // Handle adds a new route to the router.
 // The routeStruct's type should have as many fields as there are placeholders in the route.
 // A nil routeStruct is equivalent to struct{}{}.
@@ -88,47 +184,243 @@ func (route *routeInfo) serve(w http.ResponseWriter, r *http.Request, path strin
 // A value of the same type as routeStruct, filled out with the information stored in the accessed
 // path, can be retrieved within the handler using the request's Context, with the key "route".
 func (router *Router) Handle(route string, routeStruct interface{}, h http.Handler) {
-	re, err := buildRouteRegex(route)
-	if err != nil {
-		panic(err)
-	}
+	router.handle("", route, routeStruct, h)
+}
+
+// HandleFunc adds a new route to the router using a handler function. See Handle for more information.
+func (router *Router) HandleFunc(route string, routeStruct interface{}, h func(http.ResponseWriter, *http.Request)) {
+	router.Handle(route, routeStruct, http.HandlerFunc(h))
+}
+
+// HandleNamed is the same as Handle, but additionally registers route under name, so a concrete URL
+// can be reconstructed from it with Router.URLNamed regardless of how many other routes share
+// routeStruct's type. See Router.URL and Router.URLNamed for more information.
+func (router *Router) HandleNamed(name, route string, routeStruct interface{}, h http.Handler) {
+	router.handleNamed(name, "", route, routeStruct, h)
+}
+
+// Method adds a new route to the router, same as Handle, but the route only matches requests using the given
+// HTTP method. If a request's path matches a route registered with Method but not its method, ServeHTTP responds
+// with 405 Method Not Allowed and an Allow header listing the methods registered for that path, instead of
+// falling through to 404.
+func (router *Router) Method(method, route string, routeStruct interface{}, h http.Handler) {
+	router.handle(method, route, routeStruct, h)
+}
+
+// Get is shorthand for Method with http.MethodGet.
+func (router *Router) Get(route string, routeStruct interface{}, h http.Handler) {
+	router.Method(http.MethodGet, route, routeStruct, h)
+}
+
+// Post is shorthand for Method with http.MethodPost.
+func (router *Router) Post(route string, routeStruct interface{}, h http.Handler) {
+	router.Method(http.MethodPost, route, routeStruct, h)
+}
+
+// Put is shorthand for Method with http.MethodPut.
+func (router *Router) Put(route string, routeStruct interface{}, h http.Handler) {
+	router.Method(http.MethodPut, route, routeStruct, h)
+}
+
+// Patch is shorthand for Method with http.MethodPatch.
+func (router *Router) Patch(route string, routeStruct interface{}, h http.Handler) {
+	router.Method(http.MethodPatch, route, routeStruct, h)
+}
+
+// Delete is shorthand for Method with http.MethodDelete.
+func (router *Router) Delete(route string, routeStruct interface{}, h http.Handler) {
+	router.Method(http.MethodDelete, route, routeStruct, h)
+}
+
+// Options is shorthand for Method with http.MethodOptions.
+func (router *Router) Options(route string, routeStruct interface{}, h http.Handler) {
+	router.Method(http.MethodOptions, route, routeStruct, h)
+}
+
+func (router *Router) handle(method, route string, routeStruct interface{}, h http.Handler) {
+	router.handleNamed("", method, route, routeStruct, h)
+}
 
+func (router *Router) handleNamed(name, method, route string, routeStruct interface{}, h http.Handler) {
 	ty := reflect.TypeOf(routeStruct)
 	if ty == nil {
 		ty = reflect.TypeOf(struct{}{})
 	}
 
-	nfmt := re.NumSubexp()
+	scheme, host, pathRoute := splitHostScheme(route)
+
+	var hostSegs []pathSeg
+	var hostNames []string
+	*router.seq++
+	ri := routeInfo{method: method, scheme: scheme, mw: router.middlewares, h: h, ty: ty, seq: *router.seq}
+
+	if host != "" {
+		segs, ok := parseHostSegments(host)
+		if !ok {
+			panic(ErrInvalidSpecifier)
+		}
+		hostSegs = segs
+		hostNames = segNames(segs)
+		ri.hostRe = buildHostRegex(segs)
+	}
+
+	if segs, ok := trySegments(pathRoute); ok {
+		ri.ps, ri.fieldIdx = router.parsersForFields(ty, append(hostNames, segNames(segs)...))
+		router.trie.insert(segs, ri)
+		router.registerURLTemplate(name, ty, scheme, hostSegs, segs, ri.fieldIdx, ri.seq)
+		return
+	}
+
+	// route uses a specifier outside the trie's simplified grammar (e.g. a bare optional segment or
+	// a custom regex), so fall back to matching it with a regex, same as before the trie matcher
+	// existed. Such routes can't be reversed with URL/URLNamed.
+	re, names, err := buildRouteRegex(pathRoute)
+	if err != nil {
+		panic(err)
+	}
+	ri.re = re
+	ri.ps, ri.fieldIdx = router.parsersForFields(ty, append(hostNames, names...))
+	*router.routes = append(*router.routes, ri)
+}
+
+// parsersForFields builds the per-capture parser and field-index tables for ty, given the field
+// name bound to each placeholder capture in names, in order ("" for a positional placeholder).
+// Named captures are matched to the struct field of the same name (case-insensitively), panicking
+// with ErrFieldName if no such field exists; positional captures fill in the remaining fields in
+// order. It panics with ErrTooFew or ErrTooMany if that leaves too few or too many fields unbound.
+func (router *Router) parsersForFields(ty reflect.Type, names []string) (ps []parser, fieldIdx []int) {
 	narg := ty.NumField()
+	used := make([]bool, narg)
+	fieldIdx = make([]int, len(names))
 
-	if nfmt < narg {
-		panic(ErrTooFew)
-	} else if nfmt > narg {
-		panic(ErrTooMany)
+	for i, name := range names {
+		if name == "" {
+			continue
+		}
+		idx, ok := fieldByName(ty, name)
+		if !ok {
+			panic(ErrFieldName)
+		}
+		fieldIdx[i] = idx
+		used[idx] = true
 	}
 
-	parsers := make([]parser, nfmt)
-	for i := 0; i < narg; i++ {
-		parsers[i] = parserForType(ty.Field(i).Type)
+	fi := 0
+	for i, name := range names {
+		if name != "" {
+			continue
+		}
+		for fi < narg && used[fi] {
+			fi++
+		}
+		if fi >= narg {
+			panic(ErrTooMany)
+		}
+		fieldIdx[i] = fi
+		used[fi] = true
+		fi++
 	}
 
-	router.routes = append(router.routes, routeInfo{h, re, ty, parsers})
+	for _, u := range used {
+		if !u {
+			panic(ErrTooFew)
+		}
+	}
+
+	ps = make([]parser, len(names))
+	for i, idx := range fieldIdx {
+		ps[i] = router.parserForType(ty.Field(idx).Type)
+	}
+	return ps, fieldIdx
 }
 
-// HandleFunc adds a new route to the router using a handler function. See Handle for more information.
-func (router *Router) HandleFunc(route string, routeStruct interface{}, h func(http.ResponseWriter, *http.Request)) {
-	router.Handle(route, routeStruct, http.HandlerFunc(h))
+// fieldByName finds the index of ty's field named name, case-insensitively.
+func fieldByName(ty reflect.Type, name string) (int, bool) {
+	for i := 0; i < ty.NumField(); i++ {
+		if strings.EqualFold(ty.Field(i).Name, name) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// RegisterParser registers p as the parser router uses for route placeholders of type t, taking
+// precedence over both the package-level default registered with RegisterParser and the automatic
+// encoding.TextUnmarshaler support. It only affects this router, not any others.
+func (router *Router) RegisterParser(t reflect.Type, p func(string) (interface{}, error)) {
+	router.parsers[t] = p
+}
+
+// parserForType finds the parser router uses for fields of type t: router's own override if any,
+// else the package-level default, else, if t implements encoding.TextUnmarshaler, a parser
+// synthesized from UnmarshalText.
+func (router *Router) parserForType(t reflect.Type) parser {
+	if p, ok := router.parsers[t]; ok {
+		return p
+	}
+	if p, ok := defaultParserForType(t); ok {
+		return p
+	}
+	if p, ok := textUnmarshalerParser(t); ok {
+		return p
+	}
+	panic(ErrType)
+}
+
+// Use appends middleware that wraps every route registered on router afterwards, including routes
+// registered on Child routers created afterwards. It does not affect routes already registered.
+func (router *Router) Use(mw ...Middleware) {
+	router.middlewares = append(router.middlewares, mw...)
+}
+
+// With returns an inline router that shares router's routes but applies mw in addition to router's
+// own middleware, without mutating router. It's useful for adding middleware to a single route:
+//
+//	router.With(someMiddleware).Get("/admin", AdminRoute{}, adminHandler)
+func (router *Router) With(mw ...Middleware) *Router {
+	merged := make([]Middleware, 0, len(router.middlewares)+len(mw))
+	merged = append(merged, router.middlewares...)
+	merged = append(merged, mw...)
+	return &Router{
+		trie: router.trie, routes: router.routes, seq: router.seq,
+		middlewares: merged, parsers: router.parsers,
+		byType: router.byType, byName: router.byName,
+	}
 }
 
 // Child creates a new router that handles all routes with the specified prefix within the parent.
+// It inherits a copy of the parent's current middleware stack, so mounting a subtree just works.
 func (router *Router) Child(prefix string) (child *Router) {
 	child = NewRouter()
+	child.middlewares = append([]Middleware{}, router.middlewares...)
+
 	route := strings.TrimRight(prefix, "/") + "/{/?}"
-	router.Handle(route, PathRoute{}, child)
+	router.mount(route, child)
 	return child
 }
 
-func buildRouteRegex(format string) (*regexp.Regexp, error) {
+// mount registers a route that dispatches straight to h, without wrapping it in router's middleware
+// stack. It's used for Child routers, which already carry their own copy of that stack, so wrapping
+// here too would run it twice.
+func (router *Router) mount(route string, h http.Handler) {
+	segs, ok := trySegments(route)
+	if !ok {
+		// route is built by Child as prefix + "/{/?}", which fits the trie's grammar unless prefix
+		// itself contains a specifier outside it (such as {?} or {name:regex}).
+		panic(ErrInvalidSpecifier)
+	}
+
+	ty := reflect.TypeOf(PathRoute{})
+	*router.seq++
+	ri := routeInfo{h: h, ty: ty, seq: *router.seq}
+	ri.ps, ri.fieldIdx = router.parsersForFields(ty, segNames(segs))
+	router.trie.insert(segs, ri)
+}
+
+// buildRouteRegex compiles format into a regex matching the full general placeholder grammar
+// ({}, {?}, {/}, {/?} and their named and custom-regex counterparts {name}, {name?}, {name/},
+// {name/?}, {name:regex}), returning the field name bound to each capture group, in order.
+func buildRouteRegex(format string) (re *regexp.Regexp, names []string, err error) {
 	reb := strings.Builder{}
 	reb.WriteByte('^') // Anchor to start of input
 
@@ -141,7 +433,7 @@ func buildRouteRegex(format string) (*regexp.Regexp, error) {
 		end := strings.IndexByte(format, '}')
 		if end < begin {
 			// end is either -1, meaning the opening brace is unmatched, or less than begin, meaning a closing brace is unmatched
-			return nil, ErrUnmatchedBrace
+			return nil, nil, ErrUnmatchedBrace
 		}
 
 		// Write literal section
@@ -149,25 +441,21 @@ func buildRouteRegex(format string) (*regexp.Regexp, error) {
 			reb.WriteString(regexp.QuoteMeta(format[:begin]))
 		}
 
-		// Parse pattern flags
-		spec := strings.Trim(format[begin+1:end], " \t\n")
-		var optional, includeSlash bool
-		for _, ch := range spec {
-			switch ch {
-			case '?':
-				optional = true
-			case '/':
-				includeSlash = true
-			default:
-				return nil, ErrInvalidSpecifier
-			}
+		name, pattern, catchAll, optional, ok := parseSpecifier(format[begin+1 : end])
+		if !ok {
+			return nil, nil, ErrInvalidSpecifier
 		}
+		names = append(names, name)
 
 		// Write pattern section
 		reb.WriteByte('(')
-		reb.WriteString("[^/]+")
-		if includeSlash {
-			reb.WriteString("(?:/[^/]+)*?")
+		if pattern != "" {
+			reb.WriteString(neutralizeGroups(pattern))
+		} else {
+			reb.WriteString("[^/]+")
+			if catchAll {
+				reb.WriteString("(?:/[^/]+)*?")
+			}
 		}
 		reb.WriteByte(')')
 		if optional {
@@ -184,11 +472,60 @@ func buildRouteRegex(format string) (*regexp.Regexp, error) {
 
 	reb.WriteString("/*") // Allow trailing slashes
 	reb.WriteByte('$')    // Anchor to end of input
-	return regexp.Compile(reb.String())
+
+	re, err = regexp.Compile(reb.String())
+	if err != nil {
+		return nil, nil, err
+	}
+	return re, names, nil
+}
+
+// neutralizeGroups rewrites any capturing groups in pattern to non-capturing ones, so a
+// caller-supplied {name:regex} constraint containing its own "(...)" (e.g. an alternation like
+// "(foo|bar)") can't shift FindStringSubmatch's capture indices out of alignment with names/ps.
+// Named groups ("(?P<name>" and "(?<name>") are rewritten to "(?:" too. Other groups starting
+// with "(?" (such as "(?:" or "(?i)") are left alone, as are parens inside a character class or
+// escaped with a backslash.
+func neutralizeGroups(pattern string) string {
+	var b strings.Builder
+	inClass := false
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		if c == '\\' && i+1 < len(pattern) {
+			b.WriteByte(c)
+			i++
+			b.WriteByte(pattern[i])
+			continue
+		}
+		switch c {
+		case '[':
+			inClass = true
+		case ']':
+			inClass = false
+		}
+		if c == '(' && !inClass && !(i+1 < len(pattern) && pattern[i+1] == '?') {
+			b.WriteString("(?:")
+			continue
+		}
+		if c == '(' && !inClass {
+			rest := pattern[i+2:]
+			if strings.HasPrefix(rest, "P<") || (strings.HasPrefix(rest, "<") && !strings.HasPrefix(rest, "<=") && !strings.HasPrefix(rest, "<!")) {
+				if end := strings.IndexByte(rest, '>'); end >= 0 {
+					b.WriteString("(?:")
+					i += 2 + end
+					continue
+				}
+			}
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
 }
 
 type parser func(string) (interface{}, error)
 
+var parsersMu sync.RWMutex
+
 var parsers = map[reflect.Type]parser{
 	// string
 	reflect.TypeOf(""): func(s string) (interface{}, error) {
@@ -259,10 +596,47 @@ var parsers = map[reflect.Type]parser{
 	},
 }
 
-func parserForType(t reflect.Type) parser {
+// RegisterParser registers p as the package-wide default parser for t, used by any Router that
+// doesn't register its own parser for t via Router.RegisterParser. It's safe to call concurrently
+// with routing, but is typically called during program initialization.
+func RegisterParser(t reflect.Type, p func(string) (interface{}, error)) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[t] = p
+}
+
+func defaultParserForType(t reflect.Type) (parser, bool) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
 	p, ok := parsers[t]
-	if !ok {
-		panic(ErrType)
+	return p, ok
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// textUnmarshalerParser synthesizes a parser for t from its UnmarshalText method, if t (or a
+// pointer to t) implements encoding.TextUnmarshaler.
+func textUnmarshalerParser(t reflect.Type) (parser, bool) {
+	if t.Kind() == reflect.Pointer && t.Implements(textUnmarshalerType) {
+		return func(s string) (interface{}, error) {
+			v := reflect.New(t.Elem())
+			if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+				return nil, err
+			}
+			return v.Interface(), nil
+		}, true
 	}
-	return p
+
+	pt := reflect.PointerTo(t)
+	if !pt.Implements(textUnmarshalerType) {
+		return nil, false
+	}
+
+	return func(s string) (interface{}, error) {
+		v := reflect.New(t)
+		if err := v.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s)); err != nil {
+			return nil, err
+		}
+		return v.Elem().Interface(), nil
+	}, true
 }
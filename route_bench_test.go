@@ -0,0 +1,156 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func noopHandler(w http.ResponseWriter, r *http.Request) {}
+
+// legacyRouter reproduces the linear regex scan this package used to match every route before the
+// trie matcher (chunk0-3) replaced it, so the Benchmark*Legacy variants below still give an actual
+// before/after comparison now that the old matcher itself has been deleted.
+type legacyRoute struct {
+	re *regexp.Regexp
+	h  http.Handler
+}
+
+type legacyRouter struct {
+	routes []legacyRoute
+}
+
+func (lr *legacyRouter) Handle(route string, h http.Handler) {
+	re, _, err := buildRouteRegex(route)
+	if err != nil {
+		panic(err)
+	}
+	lr.routes = append(lr.routes, legacyRoute{re, h})
+}
+
+func (lr *legacyRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path + "/"
+	// Iterate backwards so more recently added routes take preference, as the old matcher did.
+	for i := len(lr.routes) - 1; i >= 0; i-- {
+		if route := lr.routes[i]; route.re.MatchString(path) {
+			route.h.ServeHTTP(w, r)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// BenchmarkStaticRoute measures a literal-only match against the very first route registered,
+// which is the worst case for the old linear regex scan (it's checked last) but costs the trie
+// matcher only as many map lookups as the path has segments.
+func BenchmarkStaticRoute(b *testing.B) {
+	r := NewRouter()
+	r.HandleFunc("/users/list", struct{}{}, noopHandler)
+	for i := 0; i < 100; i++ {
+		r.HandleFunc("/other/route/"+strconv.Itoa(i), struct{}{}, noopHandler)
+	}
+
+	req := httptest.NewRequest("GET", "/users/list", nil)
+	w := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(w, req)
+	}
+}
+
+// BenchmarkStaticRouteLegacy is BenchmarkStaticRoute against legacyRouter, for comparison.
+func BenchmarkStaticRouteLegacy(b *testing.B) {
+	lr := &legacyRouter{}
+	lr.Handle("/users/list", http.HandlerFunc(noopHandler))
+	for i := 0; i < 100; i++ {
+		lr.Handle("/other/route/"+strconv.Itoa(i), http.HandlerFunc(noopHandler))
+	}
+
+	req := httptest.NewRequest("GET", "/users/list", nil)
+	w := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lr.ServeHTTP(w, req)
+	}
+}
+
+// BenchmarkPatternRoute measures a match that captures a single {} placeholder among many
+// similarly-shaped sibling routes.
+func BenchmarkPatternRoute(b *testing.B) {
+	type userRoute struct{ ID string }
+	r := NewRouter()
+	for i := 0; i < 100; i++ {
+		r.HandleFunc("/users/"+strconv.Itoa(i)+"/{}", userRoute{}, noopHandler)
+	}
+	r.HandleFunc("/users/{}", userRoute{}, noopHandler)
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	w := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		r.ServeHTTP(w, req)
+	}
+}
+
+// BenchmarkPatternRouteLegacy is BenchmarkPatternRoute against legacyRouter, for comparison.
+func BenchmarkPatternRouteLegacy(b *testing.B) {
+	lr := &legacyRouter{}
+	for i := 0; i < 100; i++ {
+		lr.Handle("/users/"+strconv.Itoa(i)+"/{}", http.HandlerFunc(noopHandler))
+	}
+	lr.Handle("/users/{}", http.HandlerFunc(noopHandler))
+
+	req := httptest.NewRequest("GET", "/users/42", nil)
+	w := httptest.NewRecorder()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lr.ServeHTTP(w, req)
+	}
+}
+
+// BenchmarkManyRoutes measures lookup cost as the number of registered routes grows, which is
+// where the trie matcher's benefit over a linear regex scan is most visible.
+func BenchmarkManyRoutes(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			r := NewRouter()
+			for i := 0; i < n; i++ {
+				r.HandleFunc("/route/"+strconv.Itoa(i)+"/{}", struct{ V string }{}, noopHandler)
+			}
+
+			req := httptest.NewRequest("GET", "/route/"+strconv.Itoa(n/2)+"/value", nil)
+			w := httptest.NewRecorder()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.ServeHTTP(w, req)
+			}
+		})
+	}
+}
+
+// BenchmarkManyRoutesLegacy is BenchmarkManyRoutes against legacyRouter, for comparison.
+func BenchmarkManyRoutesLegacy(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			lr := &legacyRouter{}
+			for i := 0; i < n; i++ {
+				lr.Handle("/route/"+strconv.Itoa(i)+"/{}", http.HandlerFunc(noopHandler))
+			}
+
+			req := httptest.NewRequest("GET", "/route/"+strconv.Itoa(n/2)+"/value", nil)
+			w := httptest.NewRecorder()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				lr.ServeHTTP(w, req)
+			}
+		})
+	}
+}
@@ -1,10 +1,12 @@
 package route
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -110,6 +112,244 @@ func TestSlashRoute(t *testing.T) {
 	testRequest(t, r, httptest.NewRequest("GET", "/quux/frob/", nil), goodRoute{"frob"})
 }
 
+func TestEmptySegmentNotMatched(t *testing.T) {
+	r := NewRouter()
+
+	type paramRoute struct{ Foo string }
+	type catchAllRoute struct{ Path string }
+
+	h := testHandler(t)
+	r.HandleFunc("/foo/{}/bar", paramRoute{}, h)
+	r.HandleFunc("/a/{/}", catchAllRoute{}, h)
+
+	paramW := httptest.NewRecorder()
+	r.ServeHTTP(paramW, httptest.NewRequest("GET", "/foo//bar", nil))
+	if paramW.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for an empty {} segment, got %d", http.StatusNotFound, paramW.Code)
+	}
+
+	catchAllW := httptest.NewRecorder()
+	r.ServeHTTP(catchAllW, httptest.NewRequest("GET", "/a//b", nil))
+	if catchAllW.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a {/} catch-all containing an empty segment, got %d", http.StatusNotFound, catchAllW.Code)
+	}
+}
+
+func TestMethodRoute(t *testing.T) {
+	r := NewRouter()
+
+	type getRoute struct{}
+	type postRoute struct{}
+
+	h := http.HandlerFunc(testHandler(t))
+	r.Get("/foo", getRoute{}, h)
+	r.Post("/foo", postRoute{}, h)
+
+	testRequest(t, r, httptest.NewRequest("GET", "/foo", nil), getRoute{})
+	testRequest(t, r, httptest.NewRequest("POST", "/foo", nil), postRoute{})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("DELETE", "/foo", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	allow := w.Header().Get("Allow")
+	if allow != "GET, POST" && allow != "POST, GET" {
+		t.Errorf("unexpected Allow header: %q", allow)
+	}
+}
+
+func TestTriePriority(t *testing.T) {
+	r := NewRouter()
+
+	type wildRoute struct{ Foo string }
+	type litRoute struct{}
+
+	h := testHandler(t)
+	// Registered in the opposite order to TestPatternRoute: the wildcard route is now the older
+	// one, so the literal route registered afterwards must win despite being less specific.
+	r.HandleFunc("/{}", wildRoute{}, h)
+	r.HandleFunc("/foo", litRoute{}, h)
+
+	testRequest(t, r, httptest.NewRequest("GET", "/foo", nil), litRoute{})
+	testRequest(t, r, httptest.NewRequest("GET", "/bar", nil), wildRoute{"bar"})
+}
+
+func markerMiddleware(name string, log *[]string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*log = append(*log, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var log []string
+	r := NewRouter()
+
+	type plainRoute struct{}
+	type withRoute struct{}
+	type childRoute struct{}
+
+	r.Use(markerMiddleware("outer", &log))
+	r.HandleFunc("/plain", plainRoute{}, func(w http.ResponseWriter, r *http.Request) {})
+	r.With(markerMiddleware("inner", &log)).HandleFunc("/with", withRoute{}, func(w http.ResponseWriter, r *http.Request) {})
+
+	child := r.Child("/child")
+	child.HandleFunc("/foo", childRoute{}, func(w http.ResponseWriter, r *http.Request) {})
+
+	log = nil
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/plain", nil))
+	if !reflect.DeepEqual(log, []string{"outer"}) {
+		t.Errorf("expected [outer], got %v", log)
+	}
+
+	log = nil
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/with", nil))
+	if !reflect.DeepEqual(log, []string{"outer", "inner"}) {
+		t.Errorf("expected [outer inner], got %v", log)
+	}
+
+	log = nil
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/child/foo", nil))
+	if !reflect.DeepEqual(log, []string{"outer"}) {
+		t.Errorf("expected [outer] (run once, not duplicated by the mount), got %v", log)
+	}
+
+	// With must not mutate the parent's own middleware stack.
+	log = nil
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/plain", nil))
+	if !reflect.DeepEqual(log, []string{"outer"}) {
+		t.Errorf("expected [outer], got %v", log)
+	}
+}
+
+type upperString string
+
+func (u *upperString) UnmarshalText(text []byte) error {
+	*u = upperString(strings.ToUpper(string(text)))
+	return nil
+}
+
+func TestCustomParser(t *testing.T) {
+	type csvRoute struct{ Tags []string }
+	type upperRoute struct{ Name upperString }
+
+	r := NewRouter()
+	r.RegisterParser(reflect.TypeOf([]string(nil)), func(s string) (interface{}, error) {
+		return strings.Split(s, ","), nil
+	})
+
+	h := testHandler(t)
+	r.HandleFunc("/tags/{}", csvRoute{}, h)
+	r.HandleFunc("/name/{}", upperRoute{}, h)
+
+	testRequest(t, r, httptest.NewRequest("GET", "/tags/a,b,c", nil), csvRoute{[]string{"a", "b", "c"}})
+	testRequest(t, r, httptest.NewRequest("GET", "/name/bob", nil), upperRoute{"BOB"})
+}
+
+func TestHostRoute(t *testing.T) {
+	type tenantRoute struct {
+		Sub string
+		ID  string
+	}
+	type plainRoute struct{ ID string }
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleFunc("/users/{}", plainRoute{}, h)
+	r.HandleFunc("https://{}.example.com/users/{}", tenantRoute{}, h)
+
+	secure := httptest.NewRequest("GET", "/users/1", nil)
+	secure.Host = "acme.example.com"
+	secure.TLS = &tls.ConnectionState{}
+	testRequest(t, r, secure, tenantRoute{"acme", "1"})
+
+	insecure := httptest.NewRequest("GET", "/users/1", nil)
+	insecure.Host = "acme.example.com:8080"
+	testRequest(t, r, insecure, plainRoute{"1"})
+
+	other := httptest.NewRequest("GET", "/users/1", nil)
+	other.Host = "example.org"
+	testRequest(t, r, other, plainRoute{"1"})
+}
+
+func TestHostNamedPlaceholder(t *testing.T) {
+	type tenantRoute struct {
+		Sub string
+		ID  string
+	}
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleFunc("https://{sub}.example.com/users/{id}", tenantRoute{}, h)
+
+	req := httptest.NewRequest("GET", "/users/1", nil)
+	req.Host = "acme.example.com"
+	req.TLS = &tls.ConnectionState{}
+	testRequest(t, r, req, tenantRoute{"acme", "1"})
+}
+
+func TestNamedParams(t *testing.T) {
+	// Field order doesn't match placeholder order, so this only works if fields are matched by name.
+	type userRoute struct {
+		Name string
+		ID   string
+	}
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleFunc("/users/{id}/{name}", userRoute{}, h)
+
+	testRequest(t, r, httptest.NewRequest("GET", "/users/42/bob", nil), userRoute{"bob", "42"})
+}
+
+func TestNamedParamUnknownField(t *testing.T) {
+	type userRoute struct{ ID string }
+
+	defer func() {
+		if err := recover(); err != ErrFieldName {
+			t.Errorf("expected ErrFieldName, got %v", err)
+		}
+	}()
+
+	r := NewRouter()
+	r.HandleFunc("/users/{name}", userRoute{}, testHandler(t))
+}
+
+func TestRegexConstraint(t *testing.T) {
+	type userRoute struct{ ID string }
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleFunc("/users/{id:[0-9]+}", userRoute{}, h)
+
+	testRequest(t, r, httptest.NewRequest("GET", "/users/42", nil), userRoute{"42"})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/users/bob", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d for a non-numeric id, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestRegexConstraintWithGroup(t *testing.T) {
+	// pairRoute.B must still bind to the second placeholder's capture even though the first
+	// placeholder's constraint contains its own parenthesized alternation.
+	type pairRoute struct {
+		A string
+		B string
+	}
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleFunc("/p/{a:(foo|bar)}/{b}", pairRoute{}, h)
+
+	testRequest(t, r, httptest.NewRequest("GET", "/p/foo/baz", nil), pairRoute{"foo", "baz"})
+	testRequest(t, r, httptest.NewRequest("GET", "/p/bar/baz", nil), pairRoute{"bar", "baz"})
+}
+
 func TestParsedRoute(t *testing.T) {
 	r := NewRouter()
 
@@ -0,0 +1,258 @@
+package route
+
+import (
+	"sort"
+	"strings"
+)
+
+// segKind identifies what a single path segment of a route template matches.
+type segKind int
+
+const (
+	segLiteral  segKind = iota // a fixed, literal segment
+	segParam                   // {} - exactly one segment, captured
+	segCatchAll                // {/} or {/?} - all remaining segments, captured and joined with "/"
+)
+
+type pathSeg struct {
+	kind     segKind
+	lit      string // only set for segLiteral
+	name     string // only set for segParam/segCatchAll; "" for a positional placeholder
+	optional bool   // only set for segCatchAll; true for {/?} and {name/?}
+}
+
+// parseSpecifier decomposes the contents of a placeholder (the text between its braces) into the
+// field name it's bound to (empty for a positional placeholder), a custom regex pattern (empty to
+// use the default non-slash match), and whether it's a catch-all and/or optional placeholder. It
+// accepts the bare {}, {?}, {/} and {/?} forms alongside the named {name}, {name?}, {name/},
+// {name/?} and {name:regex} forms; ok is false if spec is not one of these.
+func parseSpecifier(spec string) (name, pattern string, catchAll, optional, ok bool) {
+	spec = strings.Trim(spec, " \t\n")
+
+	if i := strings.IndexByte(spec, ':'); i >= 0 {
+		name, pattern = spec[:i], spec[i+1:]
+		if pattern == "" || !isFieldName(name) {
+			return "", "", false, false, false
+		}
+		return name, pattern, false, false, true
+	}
+
+	j := len(spec)
+	for j > 0 && (spec[j-1] == '?' || spec[j-1] == '/') {
+		j--
+	}
+	name = spec[:j]
+	if name != "" && !isFieldName(name) {
+		return "", "", false, false, false
+	}
+	for _, ch := range spec[j:] {
+		switch ch {
+		case '?':
+			optional = true
+		case '/':
+			catchAll = true
+		default:
+			return "", "", false, false, false
+		}
+	}
+	return name, "", catchAll, optional, true
+}
+
+// isFieldName reports whether name is a valid Go-identifier-like placeholder name.
+func isFieldName(name string) bool {
+	for _, ch := range name {
+		if ch != '_' && !('0' <= ch && ch <= '9') && !('a' <= ch && ch <= 'z') && !('A' <= ch && ch <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// trySegments decomposes route into a sequence of literal/param/catch-all segments suitable for
+// trie-based matching. It returns ok=false for anything outside that simplified grammar (an
+// optional non-catch-all placeholder, a placeholder with a custom regex, a specifier embedded
+// within a literal segment, a catch-all that isn't the final segment, ...), so the caller can fall
+// back to the slower but fully general regex matcher.
+func trySegments(route string) (segs []pathSeg, ok bool) {
+	trimmed := strings.Trim(route, "/")
+	if trimmed == "" {
+		return nil, true
+	}
+
+	parts := splitRouteSegments(trimmed)
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return nil, false
+			}
+			segs = append(segs, pathSeg{kind: segLiteral, lit: part})
+			continue
+		}
+
+		name, pattern, catchAll, optional, specOk := parseSpecifier(part[1 : len(part)-1])
+		if !specOk || pattern != "" || (optional && !catchAll) {
+			return nil, false
+		}
+		if catchAll {
+			if i != len(parts)-1 {
+				return nil, false
+			}
+			segs = append(segs, pathSeg{kind: segCatchAll, name: name, optional: optional})
+		} else {
+			segs = append(segs, pathSeg{kind: segParam, name: name})
+		}
+	}
+	return segs, true
+}
+
+// splitRouteSegments splits a route template on '/', except for slashes inside a {...} specifier
+// (such as the one in "{/}"), which aren't segment separators.
+func splitRouteSegments(s string) []string {
+	var segs []string
+	depth := 0
+	start := 0
+	for i, c := range s {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				segs = append(segs, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	segs = append(segs, s[start:])
+	return segs
+}
+
+// segNames returns the field name bound to each non-literal segment of segs, in order, using ""
+// for positional placeholders.
+func segNames(segs []pathSeg) []string {
+	var names []string
+	for _, s := range segs {
+		if s.kind != segLiteral {
+			names = append(names, s.name)
+		}
+	}
+	return names
+}
+
+// trieNode is one node of the radix trie used to match request paths against registered routes.
+// Each node may have any mixture of a literal-segment table, a single param child and a set of
+// catch-all routes terminating there; this mirrors the {}/{/}/{/?} placeholders in a route template.
+type trieNode struct {
+	literal  map[string]*trieNode
+	param    *trieNode
+	routes   []routeInfo // routes whose template ends exactly at this node
+	catchAll []routeInfo // routes with a catch-all ending at this node
+}
+
+// insert adds ri, described by segs, to the trie rooted at n.
+func (n *trieNode) insert(segs []pathSeg, ri routeInfo) {
+	for _, s := range segs {
+		switch s.kind {
+		case segLiteral:
+			if n.literal == nil {
+				n.literal = make(map[string]*trieNode)
+			}
+			child, ok := n.literal[s.lit]
+			if !ok {
+				child = &trieNode{}
+				n.literal[s.lit] = child
+			}
+			n = child
+
+		case segParam:
+			if n.param == nil {
+				n.param = &trieNode{}
+			}
+			n = n.param
+
+		case segCatchAll:
+			ri.catchAllOptional = s.optional
+			n.catchAll = append(n.catchAll, ri)
+			return
+		}
+	}
+	n.routes = append(n.routes, ri)
+}
+
+// matchCandidate is a routeInfo that matched a request path, along with the values its placeholders
+// captured, in placeholder order (routeInfo.fieldIdx maps each one to its struct field).
+type matchCandidate struct {
+	ri      *routeInfo
+	capture []string
+}
+
+// collect appends every route reachable from n that matches segments to out. Because later Handle
+// calls must win on ambiguity regardless of whether they're more or less specific than an earlier
+// one, every matching route is collected here; ServeHTTP picks the most recently registered one
+// afterwards instead of this function preferring literal over param matches.
+func (n *trieNode) collect(segments []string, captured []string, out *[]matchCandidate) {
+	if len(n.catchAll) > 0 && !anyEmpty(segments) {
+		rest := strings.Join(segments, "/")
+		for i := range n.catchAll {
+			ri := &n.catchAll[i]
+			if rest == "" && !ri.catchAllOptional {
+				continue
+			}
+			*out = append(*out, matchCandidate{ri, appendCopy(captured, rest)})
+		}
+	}
+
+	if len(segments) == 0 {
+		for i := range n.routes {
+			*out = append(*out, matchCandidate{&n.routes[i], appendCopy(captured)})
+		}
+		return
+	}
+
+	seg, rest := segments[0], segments[1:]
+	if child, ok := n.literal[seg]; ok {
+		child.collect(rest, captured, out)
+	}
+	if n.param != nil && seg != "" {
+		n.param.collect(rest, appendCopy(captured, seg), out)
+	}
+}
+
+// anyEmpty reports whether segments contains an empty element, i.e. the original path had an
+// interior "//". A {/} catch-all joins its segments with "/", so it must reject these the same
+// way segParam's plain [^/]+ match always did, rather than silently matching a path url.go's
+// buildSegments would itself refuse to construct.
+func anyEmpty(segments []string) bool {
+	for _, s := range segments {
+		if s == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func appendCopy(s []string, extra ...string) []string {
+	out := make([]string, 0, len(s)+len(extra))
+	out = append(out, s...)
+	out = append(out, extra...)
+	return out
+}
+
+// splitSegments splits a slash-delimited request path into segments, dropping the leading and
+// trailing slash. The root path splits to an empty (nil) segment list.
+func splitSegments(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+// sortBySeqDesc orders candidates so the most recently registered route comes first, matching the
+// "later Handle wins" priority rule ServeHTTP relies on.
+func sortBySeqDesc(candidates []matchCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].ri.seq > candidates[j].ri.seq
+	})
+}
@@ -0,0 +1,131 @@
+package route
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// urlTemplate is enough information about a registered route to rebuild a concrete path from a
+// routeStruct value: the route's decomposed segments, its struct type (to catch type mismatches
+// at URLNamed time) and its registration order (to resolve ambiguity the same way ServeHTTP does).
+// scheme and hostSegs are set only for routes registered with a "scheme://host" prefix.
+type urlTemplate struct {
+	ty       reflect.Type
+	scheme   string
+	hostSegs []pathSeg
+	segs     []pathSeg
+	fieldIdx []int // fieldIdx[i] is the struct field the i'th host/path capture is read from
+	seq      int
+}
+
+// registerURLTemplate records segs as reversible for ty, and under name too if name isn't empty.
+func (router *Router) registerURLTemplate(name string, ty reflect.Type, scheme string, hostSegs, segs []pathSeg, fieldIdx []int, seq int) {
+	tmpl := urlTemplate{ty: ty, scheme: scheme, hostSegs: hostSegs, segs: segs, fieldIdx: fieldIdx, seq: seq}
+	(*router.byType)[ty] = append((*router.byType)[ty], tmpl)
+	if name != "" {
+		(*router.byName)[name] = tmpl
+	}
+}
+
+// URL reconstructs the path of the route registered for routeStruct's type, substituting its field
+// values into the route template in the same order they're captured when matching a request. If
+// more than one route was registered for that type, the most recently registered one is used,
+// mirroring the priority ServeHTTP gives ambiguous routes. Routes whose template falls back to the
+// regex matcher (one using {?}, {name:regex}, a placeholder inside a literal segment or a catch-all
+// before the final segment) can't be reversed.
+func (router *Router) URL(routeStruct interface{}) (string, error) {
+	ty := reflect.TypeOf(routeStruct)
+	tmpls := (*router.byType)[ty]
+	if len(tmpls) == 0 {
+		return "", fmt.Errorf("route: no reversible route registered for type %s", ty)
+	}
+
+	best := tmpls[0]
+	for _, t := range tmpls[1:] {
+		if t.seq > best.seq {
+			best = t
+		}
+	}
+	return buildURL(best, reflect.ValueOf(routeStruct))
+}
+
+// URLNamed reconstructs the path of the route registered under name with HandleNamed, substituting
+// routeStruct's field values into it. Unlike URL, this is unambiguous even if several routes share
+// routeStruct's type.
+func (router *Router) URLNamed(name string, routeStruct interface{}) (string, error) {
+	tmpl, ok := (*router.byName)[name]
+	if !ok {
+		return "", fmt.Errorf("route: no route registered under name %q", name)
+	}
+
+	ty := reflect.TypeOf(routeStruct)
+	if ty != tmpl.ty {
+		return "", fmt.Errorf("route: named route %q expects %s, got %s", name, tmpl.ty, ty)
+	}
+	return buildURL(tmpl, reflect.ValueOf(routeStruct))
+}
+
+// buildURL substitutes rval's fields into tmpl's host and path segments, in order, escaping each
+// segment it produces. Host fields are consumed before path fields, since they're matched first.
+func buildURL(tmpl urlTemplate, rval reflect.Value) (string, error) {
+	ci := 0
+
+	host, ci, err := buildSegments(tmpl.hostSegs, tmpl.fieldIdx, rval, ci, ".")
+	if err != nil {
+		return "", err
+	}
+
+	path, ci, err := buildSegments(tmpl.segs, tmpl.fieldIdx, rval, ci, "/")
+	if err != nil {
+		return "", err
+	}
+
+	if tmpl.scheme == "" {
+		return "/" + path, nil
+	}
+	return tmpl.scheme + "://" + host + "/" + path, nil
+}
+
+// buildSegments substitutes rval's fields into segs, reading the i'th capture's value from field
+// fieldIdx[ci], starting at ci, escaping each path segment it produces and joining them with sep.
+// It returns the joined string and the next unused capture index.
+func buildSegments(segs []pathSeg, fieldIdx []int, rval reflect.Value, ci int, sep string) (string, int, error) {
+	var parts []string
+
+	for _, s := range segs {
+		switch s.kind {
+		case segLiteral:
+			parts = append(parts, s.lit)
+
+		case segParam:
+			field := fieldIdx[ci]
+			ci++
+			v := fmt.Sprint(rval.Field(field).Interface())
+			if v == "" {
+				return "", ci, fmt.Errorf("route: field %d of %s must not be empty", field, rval.Type())
+			}
+			parts = append(parts, url.PathEscape(v))
+
+		case segCatchAll:
+			field := fieldIdx[ci]
+			ci++
+			v := fmt.Sprint(rval.Field(field).Interface())
+			if v == "" {
+				if !s.optional {
+					return "", ci, fmt.Errorf("route: field %d of %s must not be empty", field, rval.Type())
+				}
+				continue
+			}
+			for _, seg := range strings.Split(v, "/") {
+				if seg == "" {
+					return "", ci, fmt.Errorf("route: field %d of %s must not contain empty path segments", field, rval.Type())
+				}
+				parts = append(parts, url.PathEscape(seg))
+			}
+		}
+	}
+
+	return strings.Join(parts, sep), ci, nil
+}
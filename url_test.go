@@ -0,0 +1,145 @@
+package route
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	type userRoute struct{ ID string }
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleFunc("/users/{}", userRoute{}, h)
+
+	got, err := r.URL(userRoute{"42"})
+	if err != nil {
+		t.Fatalf("URL returned error: %v", err)
+	}
+	if got != "/users/42" {
+		t.Errorf("expected /users/42, got %q", got)
+	}
+}
+
+func TestURLMostRecentWins(t *testing.T) {
+	type route struct{ ID string }
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleFunc("/old/{}", route{}, h)
+	r.HandleFunc("/new/{}", route{}, h)
+
+	got, err := r.URL(route{"1"})
+	if err != nil {
+		t.Fatalf("URL returned error: %v", err)
+	}
+	if got != "/new/1" {
+		t.Errorf("expected the most recently registered route to win, got %q", got)
+	}
+}
+
+func TestURLNamed(t *testing.T) {
+	type route struct{ ID string }
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleNamed("old", "/old/{}", route{}, http.HandlerFunc(h))
+	r.HandleNamed("new", "/new/{}", route{}, http.HandlerFunc(h))
+
+	got, err := r.URLNamed("old", route{"1"})
+	if err != nil {
+		t.Fatalf("URLNamed returned error: %v", err)
+	}
+	if got != "/old/1" {
+		t.Errorf("expected /old/1, got %q", got)
+	}
+}
+
+func TestURLCatchAll(t *testing.T) {
+	type pageRoute struct{ Path string }
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleFunc("/pages/{/?}", pageRoute{}, h)
+
+	got, err := r.URL(pageRoute{"a/b/c"})
+	if err != nil {
+		t.Fatalf("URL returned error: %v", err)
+	}
+	if got != "/pages/a/b/c" {
+		t.Errorf("expected /pages/a/b/c, got %q", got)
+	}
+
+	got, err = r.URL(pageRoute{""})
+	if err != nil {
+		t.Fatalf("URL returned error: %v", err)
+	}
+	if got != "/pages" {
+		t.Errorf("expected /pages, got %q", got)
+	}
+}
+
+func TestURLEscaping(t *testing.T) {
+	type searchRoute struct{ Query string }
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleFunc("/search/{}", searchRoute{}, h)
+
+	got, err := r.URL(searchRoute{"a b/c"})
+	if err != nil {
+		t.Fatalf("URL returned error: %v", err)
+	}
+	if got != "/search/a%20b%2Fc" {
+		t.Errorf("expected the segment to be escaped, got %q", got)
+	}
+}
+
+func TestURLHost(t *testing.T) {
+	type tenantRoute struct {
+		Sub string
+		ID  string
+	}
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleFunc("https://{}.example.com/users/{}", tenantRoute{}, h)
+
+	got, err := r.URL(tenantRoute{"acme", "42"})
+	if err != nil {
+		t.Fatalf("URL returned error: %v", err)
+	}
+	if got != "https://acme.example.com/users/42" {
+		t.Errorf("expected https://acme.example.com/users/42, got %q", got)
+	}
+}
+
+func TestURLNamedParams(t *testing.T) {
+	type userRoute struct {
+		Name string
+		ID   string
+	}
+
+	r := NewRouter()
+	h := testHandler(t)
+	r.HandleFunc("/users/{id}/{name}", userRoute{}, h)
+
+	got, err := r.URL(userRoute{"bob", "42"})
+	if err != nil {
+		t.Fatalf("URL returned error: %v", err)
+	}
+	if got != "/users/42/bob" {
+		t.Errorf("expected /users/42/bob, got %q", got)
+	}
+}
+
+func TestURLUnknownType(t *testing.T) {
+	type unregisteredRoute struct{}
+
+	r := NewRouter()
+	r.HandleFunc("/foo", struct{}{}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	if _, err := r.URL(unregisteredRoute{}); err == nil {
+		t.Error("expected an error for a type with no registered route")
+	}
+}